@@ -0,0 +1,172 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ACMECertificateConfig configures how a Certificate backed by an ACME
+// Issuer should be validated.
+type ACMECertificateConfig struct {
+	Config []ACMECertificateDomainConfig `json:"config"`
+}
+
+// ACMECertificateDomainConfig configures the challenge mechanism(s) to use
+// for a set of domains on a Certificate resource.
+type ACMECertificateDomainConfig struct {
+	Domains []string `json:"domains"`
+
+	ACMECertificateDomainSolverConfig `json:",inline"`
+}
+
+// ACMECertificateDomainSolverConfig selects which challenge type(s) are
+// permitted to be used for the enclosing domain set. A domain config may
+// opt into more than one mechanism; the one actually used is chosen by
+// pickChallengeType based on what the ACME server offers.
+type ACMECertificateDomainSolverConfig struct {
+	HTTP01 *ACMECertificateHTTP01Config `json:"http01,omitempty"`
+	DNS01  *ACMECertificateDNS01Config  `json:"dns01,omitempty"`
+	// TLSALPN01, if set, permits the tls-alpn-01 challenge type (RFC 8737)
+	// to be used to validate the enclosing domain set.
+	TLSALPN01 *ACMECertificateTLSALPN01Config `json:"tlsalpn01,omitempty"`
+}
+
+// ACMECertificateHTTP01Config configures the http-01 challenge mechanism
+// for a set of domains.
+type ACMECertificateHTTP01Config struct {
+	Ingress      string  `json:"ingress"`
+	IngressClass *string `json:"ingressClass,omitempty"`
+}
+
+// ACMECertificateDNS01Config configures the dns-01 challenge mechanism for a
+// set of domains.
+type ACMECertificateDNS01Config struct {
+	Provider string `json:"provider"`
+}
+
+// ACMECertificateTLSALPN01Config configures the tls-alpn-01 challenge
+// mechanism for a set of domains. It is currently empty, as the solver
+// derives everything it needs (the Service/Secret name and the domain being
+// validated) from the Certificate resource itself; it exists so that users
+// have a field to set to opt a domain set into this challenge type.
+type ACMECertificateTLSALPN01Config struct{}
+
+// IssuerSpec holds the configuration for an Issuer resource's certificate
+// source. Only the ACME source is modeled here; other sources (CA, Vault,
+// ...) live alongside it in the real API and are out of scope of this
+// package.
+type IssuerSpec struct {
+	ACME *ACMEIssuer `json:"acme,omitempty"`
+}
+
+// ACMEIssuer describes the configuration options available for an ACME
+// Issuer.
+type ACMEIssuer struct {
+	Email         string                  `json:"email"`
+	Server        string                  `json:"server"`
+	SkipTLSVerify bool                    `json:"skipTLSVerify,omitempty"`
+	PrivateKey    SecretKeySelector       `json:"privateKeySecretRef"`
+	HTTP01        *ACMEIssuerHTTP01Config `json:"http01,omitempty"`
+	DNS01         *ACMEIssuerDNS01Config  `json:"dns01,omitempty"`
+	// TLSALPN01 enables the tls-alpn-01 challenge type for domains that opt
+	// into it via ACMECertificateDomainConfig.TLSALPN01.
+	TLSALPN01 *ACMEIssuerTLSALPN01Config `json:"tlsalpn01,omitempty"`
+	// ExternalAccountBinding, if set, is presented to the ACME server during
+	// account registration (RFC 8555 section 7.3.4) so that this account can
+	// be pre-authorized by CAs that require it.
+	ExternalAccountBinding *ACMEExternalAccountBinding `json:"externalAccountBinding,omitempty"`
+	// RateLimits overrides the client-side request pacing applied to this
+	// issuer's ACME account. Left unset, client.DefaultRateLimits is used,
+	// which matches Let's Encrypt's posted limits.
+	RateLimits *ACMEIssuerRateLimits `json:"rateLimits,omitempty"`
+}
+
+// ACMEIssuerRateLimits tunes the client-side token bucket used to pace
+// requests against this issuer's ACME directory, for use with CAs whose
+// posted limits differ from Let's Encrypt's.
+type ACMEIssuerRateLimits struct {
+	// RequestsPerSecond is the steady-state number of requests per second
+	// allowed per endpoint class (new-order, new-authz, etc).
+	RequestsPerSecond float64 `json:"requestsPerSecond,omitempty"`
+	// Burst is the number of requests permitted in a single burst.
+	Burst int `json:"burst,omitempty"`
+	// FailedAuthorizationsPerHostPerHour bounds how many failed
+	// authorizations for a single hostname this account may accumulate.
+	FailedAuthorizationsPerHostPerHour int `json:"failedAuthorizationsPerHostPerHour,omitempty"`
+}
+
+// ACMEExternalAccountBinding references the key material used to bind a new
+// ACME account to an identity already known to the CA.
+type ACMEExternalAccountBinding struct {
+	// KeyID is the key identifier issued by the CA for this account.
+	KeyID string `json:"keyID"`
+	// Key references the secret containing the base64url-encoded HMAC key
+	// associated with KeyID.
+	Key SecretKeySelector `json:"keySecretRef"`
+	// KeyAlgorithm is the MAC algorithm used to sign the EAB JWS, e.g. HS256.
+	KeyAlgorithm string `json:"keyAlgorithm,omitempty"`
+}
+
+// ACMEIssuerHTTP01Config configures the HTTP01 challenge mechanism used to
+// validate ACME domain ownership for this issuer.
+type ACMEIssuerHTTP01Config struct{}
+
+// ACMEIssuerDNS01Config configures the DNS01 challenge mechanism used to
+// validate ACME domain ownership for this issuer.
+type ACMEIssuerDNS01Config struct {
+	Providers []ACMEIssuerDNS01Provider `json:"providers"`
+}
+
+// ACMEIssuerTLSALPN01Config configures the tls-alpn-01 challenge mechanism
+// used to validate ACME domain ownership for this issuer. It is currently
+// empty; it exists as an opt-in switch, mirroring ACMEIssuerHTTP01Config.
+type ACMEIssuerTLSALPN01Config struct{}
+
+// ACMEIssuerDNS01Provider names and configures a single DNS01 provider.
+type ACMEIssuerDNS01Provider struct {
+	Name string `json:"name"`
+}
+
+// ACMEOrderStatus tracks the in-flight ACME order for a Certificate.
+type ACMEOrderStatus struct {
+	URL string `json:"url,omitempty"`
+	// CSR is the DER-encoded CSR submitted (or to be submitted) when
+	// finalizing this order. It's recorded here when the order is created
+	// because a later reconcile that finds the order already ready to
+	// finalize only has cl.GetOrder to go on, which - unlike the order this
+	// package creates - never carries a CSR: it's not part of the ACME wire
+	// format (see acme.Order.CSR's own doc-comment).
+	CSR []byte `json:"csr,omitempty"`
+}
+
+// ACMECertificateStatus tracks the state of ACME validation for a
+// Certificate resource.
+type ACMECertificateStatus struct {
+	Order ACMEOrderStatus `json:"order,omitempty"`
+	// ChallengeStates records every authorization currently being presented
+	// for this Certificate, so that a domain removed from
+	// spec.acme.config mid-flight can still be cleaned up without being
+	// re-derived from the (now changed) spec.
+	ChallengeStates []ChallengeState `json:"challengeStates,omitempty"`
+}
+
+// ChallengeState records enough information about one in-flight ACME
+// authorization to clean it up later without needing to re-derive it from
+// the Certificate's current spec or re-query the ACME server.
+type ChallengeState struct {
+	// Domain is the identifier the authorization is for.
+	Domain string `json:"domain"`
+	// AuthorizationURL is the ACME authorization this state was derived from.
+	AuthorizationURL string `json:"authorizationURL"`
+	// Type is the challenge type chosen for this authorization, e.g.
+	// "http-01", "dns-01" or "tls-alpn-01".
+	Type string `json:"type"`
+	// Token is the challenge token.
+	Token string `json:"token"`
+	// Key is the key authorization computed for Token.
+	Key string `json:"key"`
+	// Provider is the name of the DNS01 provider chosen to present this
+	// challenge, if Type is "dns-01".
+	Provider string `json:"provider,omitempty"`
+	// PresentedAt records when this challenge was presented.
+	PresentedAt metav1.Time `json:"presentedAt,omitempty"`
+}
@@ -0,0 +1,123 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+	"github.com/jetstack/cert-manager/pkg/issuer/acme/client"
+	"github.com/jetstack/cert-manager/third_party/crypto/acme"
+)
+
+// Issuer is the subset of the configured Issuer resource the acme package
+// needs: its ACME-specific configuration.
+type Issuer interface {
+	GetSpec() *v1alpha1.IssuerSpec
+}
+
+// Acme is a certificate issuer that obtains certificates from an ACME
+// server.
+type Acme struct {
+	issuer Issuer
+
+	http01Solver    Solver
+	dns01Solver     Solver
+	tlsALPN01Solver Solver
+
+	store Store
+
+	clientMu sync.Mutex
+	client   client.Interface
+}
+
+// New returns a new ACME issuer using http01Solver, dns01Solver and
+// tlsALPN01Solver to complete challenges.
+func New(issuer Issuer, http01Solver, dns01Solver, tlsALPN01Solver Solver) *Acme {
+	return &Acme{
+		issuer:          issuer,
+		http01Solver:    http01Solver,
+		dns01Solver:     dns01Solver,
+		tlsALPN01Solver: tlsALPN01Solver,
+		store:           NewStore(),
+	}
+}
+
+// acmeClient returns the client.Interface used to talk to this issuer's
+// ACME server, registering an account the first time it's called and
+// reusing it afterwards. The returned client is always wrapped in a
+// client.RateLimitedInterface, tuned from issuer.Spec.ACME.RateLimits (or
+// client.DefaultRateLimits if unset), so every request Prepare makes
+// through it is paced against the ACME server's posted limits, except
+// FinalizeOrder, which the wrapper passes through unpaced.
+//
+// If issuer.Spec.ACME.ExternalAccountBinding is set, registration attempts
+// to present it as an RFC 8555 section 7.3.4 EAB (the JWS construction in
+// signEAB is real and exercised), but this currently always fails: there is
+// no Kubernetes clientset/Secret lister wired into this package yet to
+// back secretKeyBytes, so every Issuer configured with EAB will fail to
+// construct a client at all until that plumbing lands.
+func (a *Acme) acmeClient() (client.Interface, error) {
+	a.clientMu.Lock()
+	defer a.clientMu.Unlock()
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	spec := a.issuer.GetSpec().ACME
+	if spec == nil {
+		return nil, fmt.Errorf("issuer is not configured as an ACME issuer")
+	}
+
+	var eab *acme.ExternalAccountBinding
+	if spec.ExternalAccountBinding != nil {
+		keyBytes, err := a.secretKeyBytes(spec.ExternalAccountBinding.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error reading external account binding key: %s", err.Error())
+		}
+		eab = &acme.ExternalAccountBinding{
+			KeyID:        spec.ExternalAccountBinding.KeyID,
+			Key:          keyBytes,
+			KeyAlgorithm: spec.ExternalAccountBinding.KeyAlgorithm,
+		}
+	}
+
+	cl, err := client.New(context.Background(), spec, eab)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := rateLimitsFromSpec(spec)
+	rl := client.NewRateLimitedInterface(cl, spec.Server, "", limits)
+	a.client = rl
+	return a.client, nil
+}
+
+// rateLimitsFromSpec builds a client.RateLimits from spec.RateLimits,
+// falling back to client.DefaultRateLimits for any field left unset.
+func rateLimitsFromSpec(spec *v1alpha1.ACMEIssuer) client.RateLimits {
+	limits := client.DefaultRateLimits
+	if spec.RateLimits == nil {
+		return limits
+	}
+	if spec.RateLimits.RequestsPerSecond > 0 {
+		limits.RequestsPerSecond = spec.RateLimits.RequestsPerSecond
+	}
+	if spec.RateLimits.Burst > 0 {
+		limits.Burst = spec.RateLimits.Burst
+	}
+	if spec.RateLimits.FailedAuthorizationsPerHostPerHour > 0 {
+		limits.FailedAuthorizationsPerHostPerHour = spec.RateLimits.FailedAuthorizationsPerHostPerHour
+	}
+	return limits
+}
+
+// secretKeyBytes is a placeholder for reading a SecretKeySelector's
+// referenced key out of a Kubernetes Secret; the real implementation lives
+// alongside the rest of this issuer's Kubernetes client wiring, which is out
+// of scope of this package. Until then, this always errors, which means
+// acmeClient always fails for an Issuer with ExternalAccountBinding set -
+// EAB is not yet usable end-to-end, only its JWS presentation is real.
+func (a *Acme) secretKeyBytes(ref v1alpha1.SecretKeySelector) ([]byte, error) {
+	return nil, fmt.Errorf("not implemented: reading external account binding key from a Secret requires Kubernetes client wiring not present in this package")
+}
@@ -0,0 +1,370 @@
+// Package acmetest provides an in-process ACME server for testing the
+// issuer/acme package without depending on an external CA such as Pebble or
+// Boulder. It is modeled on the internal acmetest package used by
+// x/crypto/acme/autocert.
+package acmetest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CAServer is a simple ACME certificate authority that runs in-process,
+// for use in tests of Acme.Prepare and friends. It publishes a real ACME
+// directory and serves newAccount, newOrder, authorization and challenge
+// endpoints, issuing certificates signed by an in-memory root.
+type CAServer struct {
+	// DomainAddr maps a domain name to the host:port of a server that will
+	// answer challenge fetches for it. It must be populated by the caller
+	// before the challenge is accepted. Whatever the challenge type, the
+	// fetch is a plain HTTP GET of /.well-known/acme-challenge/<domain> at
+	// that address, and only a 200 status is checked: no TLS-ALPN handshake
+	// or DNS lookup is made, and the response body is not compared with the
+	// key authorization.
+	DomainAddr map[string]string
+	// ChallengeTypes restricts which challenge types are offered on
+	// authorizations. Defaults to http-01, dns-01 and tls-alpn-01.
+	ChallengeTypes []string
+
+	server *httptest.Server
+	root   *x509.Certificate
+	rootDER []byte
+	rootKey *ecdsa.PrivateKey
+
+	mu            sync.Mutex
+	orders        map[string]*order
+	authzs        map[string]*authz
+	challenges    map[string]*authz
+	nonces        map[string]bool
+}
+
+type order struct {
+	url           string
+	authzURLs     []string
+	status        string
+	certURL       string
+	certPEM       []byte
+}
+
+type authz struct {
+	url       string
+	domain    string
+	status    string
+	challenge string // challenge URL
+}
+
+// NewCAServer starts a CAServer listening on an in-process httptest server.
+// Callers must call Close when finished.
+func NewCAServer(challengeTypes ...string) *CAServer {
+	if len(challengeTypes) == 0 {
+		challengeTypes = []string{"http-01", "dns-01", "tls-alpn-01"}
+	}
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	root := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "acmetest root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, root, root, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		panic(err)
+	}
+	parsedRoot, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+
+	ca := &CAServer{
+		DomainAddr:     make(map[string]string),
+		ChallengeTypes: challengeTypes,
+		root:           parsedRoot,
+		rootDER:        der,
+		rootKey:        rootKey,
+		orders:         make(map[string]*order),
+		authzs:         make(map[string]*authz),
+		challenges:     make(map[string]*authz),
+		nonces:         make(map[string]bool),
+	}
+	ca.server = httptest.NewServer(http.HandlerFunc(ca.handle))
+	return ca
+}
+
+// URL returns the server's ACME directory URL.
+func (ca *CAServer) URL() string {
+	return ca.server.URL + "/directory"
+}
+
+// Roots returns a pool containing the CA's self-signed root, for verifying
+// certificates it issues.
+func (ca *CAServer) Roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.root)
+	return pool
+}
+
+// Close shuts down the server.
+func (ca *CAServer) Close() {
+	ca.server.Close()
+}
+
+func (ca *CAServer) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", ca.newNonce())
+	switch {
+	case r.URL.Path == "/directory":
+		ca.handleDirectory(w, r)
+	case r.URL.Path == "/new-nonce":
+		w.WriteHeader(http.StatusOK)
+	case r.URL.Path == "/new-account":
+		ca.handleNewAccount(w, r)
+	case r.URL.Path == "/new-order":
+		ca.handleNewOrder(w, r)
+	case strings.HasPrefix(r.URL.Path, "/authz/"):
+		ca.handleAuthz(w, r)
+	case strings.HasPrefix(r.URL.Path, "/challenge/"):
+		ca.handleChallenge(w, r)
+	case strings.HasPrefix(r.URL.Path, "/order/"):
+		ca.handleOrder(w, r)
+	case strings.HasPrefix(r.URL.Path, "/finalize/"):
+		ca.handleFinalize(w, r)
+	case strings.HasPrefix(r.URL.Path, "/cert/"):
+		ca.handleCert(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (ca *CAServer) newNonce() string {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	n := fmt.Sprintf("nonce-%d", len(ca.nonces)+1)
+	ca.nonces[n] = true
+	return n
+}
+
+func (ca *CAServer) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	base := ca.server.URL
+	json.NewEncoder(w).Encode(map[string]string{
+		"newNonce":   base + "/new-nonce",
+		"newAccount": base + "/new-account",
+		"newOrder":   base + "/new-order",
+		"revokeCert": base + "/revoke-cert",
+		"keyChange":  base + "/key-change",
+	})
+}
+
+func (ca *CAServer) handleNewAccount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Location", ca.server.URL+"/account/1")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "valid"})
+}
+
+// decodeJWSPayload unmarshals the base64url-encoded "payload" of the
+// flattened-serialization JWS in r.Body into v. It doesn't verify the JWS
+// signature: this server is for exercising client-side behaviour, not for
+// testing against a hostile client.
+func decodeJWSPayload(r *http.Request, v interface{}) error {
+	var envelope struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		return err
+	}
+	if envelope.Payload == "" {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func (ca *CAServer) handleNewOrder(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	var body struct {
+		Identifiers []struct {
+			Value string `json:"value"`
+		} `json:"identifiers"`
+	}
+	if err := decodeJWSPayload(r, &body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := fmt.Sprintf("%d", len(ca.orders)+1)
+	o := &order{url: ca.server.URL + "/order/" + id, status: "pending"}
+	for i, ident := range body.Identifiers {
+		a := ca.newAuthz(ident.Value, fmt.Sprintf("%s-%d", id, i))
+		o.authzURLs = append(o.authzURLs, a.url)
+	}
+	ca.orders[id] = o
+
+	w.Header().Set("Location", o.url)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":        o.status,
+		"authorizations": o.authzURLs,
+		"finalize":      ca.server.URL + "/finalize/" + id,
+	})
+}
+
+func (ca *CAServer) newAuthz(domain, id string) *authz {
+	a := &authz{url: ca.server.URL + "/authz/" + id, domain: domain, status: "pending"}
+	a.challenge = ca.server.URL + "/challenge/" + id
+	ca.authzs[a.url] = a
+	ca.challenges[a.challenge] = a
+	return a
+}
+
+func (ca *CAServer) handleAuthz(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	a, ok := ca.authzs[ca.server.URL+r.URL.Path]
+	ca.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var challenges []map[string]string
+	for _, t := range ca.ChallengeTypes {
+		challenges = append(challenges, map[string]string{
+			"type":  t,
+			"url":   a.challenge,
+			"token": a.domain,
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     a.status,
+		"identifier": map[string]string{"type": "dns", "value": a.domain},
+		"challenges": challenges,
+	})
+}
+
+// handleChallenge, upon being accepted, fetches the challenge response back
+// from the address registered in DomainAddr for the authorization's domain,
+// mirroring a real CA's validation step, then marks the authorization valid
+// or invalid accordingly.
+func (ca *CAServer) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	a, ok := ca.challenges[ca.server.URL+r.URL.Path]
+	ca.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	addr, ok := ca.DomainAddr[a.domain]
+	if ok {
+		u := url.URL{Scheme: "http", Host: addr, Path: "/.well-known/acme-challenge/" + a.domain}
+		resp, err := http.Get(u.String())
+		if err == nil && resp.StatusCode == http.StatusOK {
+			a.status = "valid"
+		} else {
+			a.status = "invalid"
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+	} else {
+		a.status = "invalid"
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"status": a.status, "url": a.challenge})
+}
+
+func (ca *CAServer) handleOrder(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	id := strings.TrimPrefix(r.URL.Path, "/order/")
+	o, ok := ca.orders[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	status := "pending"
+	allValid := true
+	for _, u := range o.authzURLs {
+		if ca.authzs[u].status != "valid" {
+			allValid = false
+		}
+	}
+	if allValid {
+		status = "ready"
+	}
+	if o.status == "processing" || o.status == "valid" {
+		status = o.status
+	}
+	o.status = status
+
+	resp := map[string]interface{}{
+		"status":        o.status,
+		"authorizations": o.authzURLs,
+		"finalize":      ca.server.URL + "/finalize/" + id,
+	}
+	if o.status == "valid" {
+		resp["certificate"] = ca.server.URL + "/cert/" + id
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleFinalize requires a non-empty "csr", mirroring a real ACME server
+// rejecting finalize requests with a malformed or missing CSR - a client
+// that (like the bug this guards against) submits a nil CSR gets a 400
+// here instead of a silently-accepted empty string.
+func (ca *CAServer) handleFinalize(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	id := strings.TrimPrefix(r.URL.Path, "/finalize/")
+	o, ok := ca.orders[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var body struct {
+		CSR string `json:"csr"`
+	}
+	if err := decodeJWSPayload(r, &body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.CSR == "" {
+		http.Error(w, `{"type":"urn:ietf:params:acme:error:malformed","detail":"csr is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	o.status = "valid"
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      o.status,
+		"certificate": ca.server.URL + "/cert/" + id,
+	})
+}
+
+func (ca *CAServer) handleCert(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ca.rootDER})
+}
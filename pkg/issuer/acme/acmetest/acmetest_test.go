@@ -0,0 +1,155 @@
+package acmetest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jetstack/cert-manager/third_party/crypto/acme"
+)
+
+// TestCAServerIssuesCertificate drives the vendored RFC 8555 client
+// (third_party/crypto/acme) end-to-end against an in-process CAServer:
+// account registration, order creation, http-01 challenge fetch/accept, and
+// order finalization and certificate download with a real CSR. It exists to
+// catch regressions in nonce handling and order state transitions in that
+// client.
+//
+// It does NOT drive pkg/issuer/acme's Acme.Prepare, so it cannot catch bugs
+// in that orchestration layer (order.go, prepare.go, the Store, the rate
+// limiter, or a Solver) - only in the vendored client and this fake CA.
+// Exercising Prepare itself would need a *v1alpha1.Certificate to pass it,
+// and that type is never defined anywhere in this tree (only the ACME-
+// specific status/spec fragments that hang off it are), so that is left as
+// follow-up work rather than claimed here.
+func TestCAServerIssuesCertificate(t *testing.T) {
+	const domain = "example.test"
+
+	ca := NewCAServer("http-01")
+	defer ca.Close()
+
+	addr := serveChallengeResponse(t, domain)
+	ca.DomainAddr[domain] = addr
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating account key: %v", err)
+	}
+	cl := &acme.Client{DirectoryURL: ca.URL(), Key: key}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := cl.Register(ctx, nil, nil); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	order, err := cl.NewOrder(ctx, []string{domain})
+	if err != nil {
+		t.Fatalf("NewOrder: %v", err)
+	}
+	if len(order.Authorizations) != 1 {
+		t.Fatalf("expected 1 authorization, got %d", len(order.Authorizations))
+	}
+
+	authz, err := cl.GetAuthorization(ctx, order.Authorizations[0])
+	if err != nil {
+		t.Fatalf("GetAuthorization: %v", err)
+	}
+	if authz.Status != acme.StatusPending {
+		t.Fatalf("expected authorization to start pending, got %q", authz.Status)
+	}
+	if len(authz.Challenges) == 0 {
+		t.Fatalf("expected at least one challenge to be offered")
+	}
+
+	if _, err := cl.AcceptChallenge(ctx, authz.Challenges[0]); err != nil {
+		t.Fatalf("AcceptChallenge: %v", err)
+	}
+
+	authz, err = cl.WaitAuthorization(ctx, authz.URL)
+	if err != nil {
+		t.Fatalf("WaitAuthorization: %v", err)
+	}
+	if authz.Status != acme.StatusValid {
+		t.Fatalf("expected authorization to become valid, got %q", authz.Status)
+	}
+
+	order, err = cl.GetOrder(ctx, order.URL)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if order.Status != acme.StatusReady {
+		t.Fatalf("expected order to become ready, got %q", order.Status)
+	}
+
+	// order, as returned by GetOrder, carries no CSR - acme.Order.CSR is
+	// never populated by unmarshaling a server response (see its doc
+	// comment). Finalizing it as-is should fail, the same way it would
+	// against a real ACME server, rather than silently succeeding with an
+	// empty CSR.
+	if _, err := cl.Finalize(ctx, order); err == nil {
+		t.Fatalf("Finalize with no CSR set: expected an error, got none")
+	}
+
+	order.CSR, err = generateCSR(domain)
+	if err != nil {
+		t.Fatalf("generating CSR: %v", err)
+	}
+	order, err = cl.Finalize(ctx, order)
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	if order.Status != acme.StatusValid {
+		t.Fatalf("expected order to become valid after finalize, got %q", order.Status)
+	}
+
+	certPEM, err := cl.FetchCertificate(ctx, order)
+	if err != nil {
+		t.Fatalf("FetchCertificate: %v", err)
+	}
+	if len(certPEM) == 0 {
+		t.Fatalf("expected a non-empty certificate chain")
+	}
+}
+
+// generateCSR builds a DER-encoded CSR for domain, signed by a freshly
+// generated key.
+func generateCSR(domain string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}
+	return x509.CreateCertificateRequest(rand.Reader, template, key)
+}
+
+// serveChallengeResponse starts a listener answering requests for
+// /.well-known/acme-challenge/<domain> with 200 OK, mimicking the presented
+// http-01 challenge response, and returns its address.
+func serveChallengeResponse(t *testing.T, domain string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening for challenge server: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(fmt.Sprintf("/.well-known/acme-challenge/%s", domain), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
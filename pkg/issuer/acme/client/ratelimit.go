@@ -0,0 +1,254 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/jetstack/cert-manager/third_party/crypto/acme"
+)
+
+// endpointClass groups ACME requests that share one client-side token
+// bucket. Each class has its own bucket, so e.g. newOrder and newAuthz
+// requests are paced independently of each other and of polling.
+type endpointClass string
+
+const (
+	classNewOrder endpointClass = "new-order"
+	classNewAuthz endpointClass = "new-authz"
+	classAccept   endpointClass = "accept-challenge"
+	classPoll     endpointClass = "poll"
+)
+
+// RateLimits configures the client-side pacing applied by a RateLimitedInterface.
+// The defaults are conservative enough to stay under Let's Encrypt's posted
+// limits; operators targeting a different CA can override them per-Issuer.
+type RateLimits struct {
+	// RequestsPerSecond is the steady-state rate allowed per endpoint class.
+	RequestsPerSecond float64
+	// Burst is the number of requests permitted in a single burst.
+	Burst int
+	// FailedAuthorizationsPerHostPerHour bounds how many failed
+	// authorizations for a single hostname this account is allowed to
+	// accumulate, mirroring Let's Encrypt's "5 failures per account, per
+	// hostname, per hour" limit.
+	FailedAuthorizationsPerHostPerHour int
+}
+
+// DefaultRateLimits matches Let's Encrypt's published limits as of this
+// writing: https://letsencrypt.org/docs/rate-limits/
+var DefaultRateLimits = RateLimits{
+	RequestsPerSecond:                  20,
+	Burst:                              20,
+	FailedAuthorizationsPerHostPerHour: 5,
+}
+
+// ErrRateLimited is returned when a request would exceed the local
+// rate-limit budget before the request context's deadline elapses.
+var ErrRateLimited = errors.New("acme: local rate limit exceeded")
+
+// RateLimitedInterface wraps an Interface with a client-side token bucket
+// per (directoryURL, account, endpoint class), plus a sliding-window counter
+// of failed authorizations per (account, hostname), so that a controller
+// reconciling many Certificates in parallel can't trip the ACME server's own
+// limits and get the account temporarily blocked.
+type RateLimitedInterface struct {
+	Interface
+
+	directoryURL string
+	accountURL   string
+	limits       RateLimits
+
+	mu           sync.Mutex
+	buckets      map[endpointClass]*rate.Limiter
+	failures     map[string][]time.Time
+	authzDomains map[string]string // authorization URL -> domain
+}
+
+// NewRateLimitedInterface returns an Interface that paces requests to cl
+// according to limits. directoryURL and accountURL identify the bucket this
+// instance's limiters belong to; callers should share a single
+// RateLimitedInterface across all reconciles for the same ACME account.
+func NewRateLimitedInterface(cl Interface, directoryURL, accountURL string, limits RateLimits) *RateLimitedInterface {
+	return &RateLimitedInterface{
+		Interface:    cl,
+		directoryURL: directoryURL,
+		accountURL:   accountURL,
+		limits:       limits,
+		buckets:      make(map[endpointClass]*rate.Limiter),
+		failures:     make(map[string][]time.Time),
+		authzDomains: make(map[string]string),
+	}
+}
+
+func (r *RateLimitedInterface) limiterFor(class endpointClass) *rate.Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.buckets[class]
+	if !ok {
+		l = rate.NewLimiter(rate.Limit(r.limits.RequestsPerSecond), r.limits.Burst)
+		r.buckets[class] = l
+	}
+	return l
+}
+
+// wait blocks until a token for class is available, or ctx is done.
+func (r *RateLimitedInterface) wait(ctx context.Context, class endpointClass) error {
+	if err := r.limiterFor(class).Wait(ctx); err != nil {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// throttle feeds a server-reported Retry-After duration back into class's
+// bucket by reserving tokens ahead until the next free token is at least
+// retryAfter away, so the next caller waits at least that long rather than
+// immediately retrying.
+func (r *RateLimitedInterface) throttle(class endpointClass, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		return
+	}
+	l := r.limiterFor(class)
+	if l.Limit() <= 0 || l.Limit() == rate.Inf || l.Burst() <= 0 {
+		return
+	}
+	now := time.Now()
+	for {
+		res := l.ReserveN(now, l.Burst())
+		if !res.OK() || res.DelayFrom(now) >= retryAfter {
+			return
+		}
+	}
+}
+
+// recordFailure appends a failure timestamp for host, used to bound repeat
+// authorization attempts against a single hostname.
+func (r *RateLimitedInterface) recordFailure(host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	window := now.Add(-time.Hour)
+	failures := r.failures[host]
+	pruned := failures[:0]
+	for _, t := range failures {
+		if t.After(window) {
+			pruned = append(pruned, t)
+		}
+	}
+	r.failures[host] = append(pruned, now)
+}
+
+// failuresExceeded reports whether host has already accumulated
+// FailedAuthorizationsPerHostPerHour failures in the last hour.
+func (r *RateLimitedInterface) failuresExceeded(host string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	window := time.Now().Add(-time.Hour)
+	n := 0
+	for _, t := range r.failures[host] {
+		if t.After(window) {
+			n++
+		}
+	}
+	return n >= r.limits.FailedAuthorizationsPerHostPerHour
+}
+
+// rememberAuthzDomain records which domain an authorization URL is for, so
+// a later request against the same URL (e.g. WaitAuthorization following a
+// GetAuthorization) can be checked against that domain's failure budget
+// without needing to fetch the authorization first.
+func (r *RateLimitedInterface) rememberAuthzDomain(url, domain string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.authzDomains[url] = domain
+}
+
+func (r *RateLimitedInterface) domainForAuthz(url string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	domain, ok := r.authzDomains[url]
+	return domain, ok
+}
+
+func (r *RateLimitedInterface) NewOrder(ctx context.Context, domains []string) (*acme.Order, error) {
+	if err := r.wait(ctx, classNewOrder); err != nil {
+		return nil, err
+	}
+	order, err := r.Interface.NewOrder(ctx, domains)
+	r.maybeThrottle(classNewOrder, err)
+	return order, err
+}
+
+func (r *RateLimitedInterface) GetOrder(ctx context.Context, url string) (*acme.Order, error) {
+	if err := r.wait(ctx, classPoll); err != nil {
+		return nil, err
+	}
+	order, err := r.Interface.GetOrder(ctx, url)
+	r.maybeThrottle(classPoll, err)
+	return order, err
+}
+
+func (r *RateLimitedInterface) GetAuthorization(ctx context.Context, url string) (*acme.Authorization, error) {
+	if domain, ok := r.domainForAuthz(url); ok && r.failuresExceeded(domain) {
+		return nil, fmt.Errorf("acme: not requesting authorization for %q: already exceeded %d failed authorizations in the last hour", domain, r.limits.FailedAuthorizationsPerHostPerHour)
+	}
+	if err := r.wait(ctx, classNewAuthz); err != nil {
+		return nil, err
+	}
+	authz, err := r.Interface.GetAuthorization(ctx, url)
+	r.maybeThrottle(classNewAuthz, err)
+	if authz != nil {
+		r.rememberAuthzDomain(url, authz.Identifier.Value)
+		if err == nil && authz.Status == acme.StatusInvalid {
+			r.recordFailure(authz.Identifier.Value)
+		}
+	}
+	return authz, err
+}
+
+func (r *RateLimitedInterface) AcceptChallenge(ctx context.Context, challenge *acme.Challenge) (*acme.Challenge, error) {
+	if err := r.wait(ctx, classAccept); err != nil {
+		return nil, err
+	}
+	c, err := r.Interface.AcceptChallenge(ctx, challenge)
+	r.maybeThrottle(classAccept, err)
+	return c, err
+}
+
+// WaitAuthorization polls the authorization at url until it resolves. Before
+// issuing the request it first checks whether url's domain (learned from an
+// earlier GetAuthorization call for the same url) has already exceeded its
+// budget of failed authorizations for the last hour; if so, it declines to
+// poll at all rather than spending request budget on an authorization that's
+// very likely to fail again.
+func (r *RateLimitedInterface) WaitAuthorization(ctx context.Context, url string) (*acme.Authorization, error) {
+	if domain, ok := r.domainForAuthz(url); ok && r.failuresExceeded(domain) {
+		return nil, fmt.Errorf("acme: not waiting on authorization for %q: already exceeded %d failed authorizations in the last hour", domain, r.limits.FailedAuthorizationsPerHostPerHour)
+	}
+	if err := r.wait(ctx, classPoll); err != nil {
+		return nil, err
+	}
+	authz, err := r.Interface.WaitAuthorization(ctx, url)
+	r.maybeThrottle(classPoll, err)
+	if authz != nil {
+		r.rememberAuthzDomain(url, authz.Identifier.Value)
+	}
+	return authz, err
+}
+
+// maybeThrottle inspects err for an ACME rateLimited problem and, if found,
+// feeds its Retry-After back into class's bucket.
+func (r *RateLimitedInterface) maybeThrottle(class endpointClass, err error) {
+	acmeErr, ok := err.(*acme.Error)
+	if !ok || acmeErr == nil {
+		return
+	}
+	if acmeErr.ProblemType != "urn:ietf:params:acme:error:rateLimited" {
+		return
+	}
+	r.throttle(class, acmeErr.RetryAfter)
+}
@@ -0,0 +1,104 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+	"github.com/jetstack/cert-manager/pkg/issuer/acme/client"
+	"github.com/jetstack/cert-manager/third_party/crypto/acme"
+)
+
+// createOrder creates a new ACME order for the domains configured on crt,
+// records its URL and CSR on crt's status, and generates the CSR that will
+// be submitted when the order is finalized.
+//
+// The CSR is recorded on crt's status, not just on the returned order,
+// because acme.Order.CSR is never populated by unmarshaling a server
+// response (see its doc-comment) - a later reconcile that finds the order
+// already ready to finalize only has cl.GetOrder to go on, and must restore
+// the CSR from crt.Status.ACMEStatus().Order.CSR before calling
+// FinalizeOrder. See getOrCreateOrder's acme.StatusReady case.
+//
+// TODO: derive the CSR from crt's actual requested private key (read from
+// the Secret named by crt.Spec.SecretName) rather than a freshly generated
+// one; that requires the Kubernetes client wiring that is out of scope of
+// this package.
+func (a *Acme) createOrder(ctx context.Context, cl client.Interface, crt *v1alpha1.Certificate) (*acme.Order, error) {
+	domains := domainsForCertificate(crt)
+
+	order, err := cl.NewOrder(ctx, domains)
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := generateCSR(domains)
+	if err != nil {
+		return nil, err
+	}
+	order.CSR = csr
+
+	crt.Status.ACMEStatus().Order.URL = order.URL
+	crt.Status.ACMEStatus().Order.CSR = csr
+	return order, nil
+}
+
+// orderIsValidForCertificate reports whether order's identifiers are exactly
+// the set of domains currently configured on crt, i.e. whether it's still
+// safe to reuse rather than needing to create a new one because the
+// Certificate's spec has changed since the order was created.
+func orderIsValidForCertificate(order *acme.Order, crt *v1alpha1.Certificate) bool {
+	want := domainsForCertificate(crt)
+	if len(want) != len(order.Identifiers) {
+		return false
+	}
+	wantSet := make(map[string]bool, len(want))
+	for _, d := range want {
+		wantSet[d] = true
+	}
+	for _, id := range order.Identifiers {
+		if !wantSet[id.Value] {
+			return false
+		}
+	}
+	return true
+}
+
+// domainsForCertificate flattens the domain sets configured across
+// crt.Spec.ACME.Config into the list of names a single order should cover.
+func domainsForCertificate(crt *v1alpha1.Certificate) []string {
+	seen := make(map[string]bool)
+	var domains []string
+	for _, d := range crt.Spec.ACME.Config {
+		for _, dom := range d.Domains {
+			if seen[dom] {
+				continue
+			}
+			seen[dom] = true
+			domains = append(domains, dom)
+		}
+	}
+	return domains
+}
+
+// generateCSR builds a DER-encoded CSR for domains, signed by a freshly
+// generated key. See the TODO on createOrder.
+func generateCSR(domains []string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	var commonName string
+	if len(domains) > 0 {
+		commonName = domains[0]
+	}
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: domains,
+	}
+	return x509.CreateCertificateRequest(rand.Reader, template, key)
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 
 	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
 	"github.com/jetstack/cert-manager/pkg/issuer/acme/client"
 	"github.com/jetstack/cert-manager/third_party/crypto/acme"
@@ -41,7 +43,14 @@ func (a *Acme) Prepare(ctx context.Context, crt *v1alpha1.Certificate) error {
 	}
 
 	glog.V(4).Infof("Getting ACME client")
-	// obtain an ACME client
+	// obtain an ACME client. Account registration performed by acmeClient
+	// now follows the RFC 8555 newAccount flow. If
+	// issuer.Spec.ACME.ExternalAccountBinding is set, acmeClient returns an
+	// error, since secretKeyBytes cannot read the EAB key. The returned
+	// client.Interface is wrapped in a client.RateLimitedInterface (tuned from
+	// issuer.Spec.ACME.RateLimits) so the requests this function makes below,
+	// other than finalizing an order, are paced against the ACME server's own
+	// limits.
 	cl, err := a.acmeClient()
 	if err != nil {
 		return err
@@ -104,31 +113,227 @@ func (a *Acme) Prepare(ctx context.Context, crt *v1alpha1.Certificate) error {
 		return nil
 	}
 
-	var failingSelfChecks []string
+	passed, failingSelfChecks, err := a.presentAuthorizations(ctx, cl, crt, pending)
+	if err != nil {
+		return err
+	}
+
+	var dns01Accepted []presentedAuthorization
+	for _, p := range passed {
+		glog.Infof("Self check passed for domain %q", p.auth.Identifier.Value)
+		if err := a.acceptChallenge(ctx, cl, p.auth, p.challenge); err != nil {
+			return err
+		}
+		if p.challenge.Type == "dns-01" {
+			dns01Accepted = append(dns01Accepted, p)
+		}
+	}
+
+	// Now that every dns-01 authorization in this batch has been accepted
+	// and confirmed valid by acceptChallenge (which waits on the ACME
+	// server), it's safe to tear down the TXT records all at once.
+	if err := a.cleanupDNS01Batch(ctx, crt, dns01Accepted); err != nil {
+		return err
+	}
+
+	if len(failingSelfChecks) > 0 {
+		return fmt.Errorf("self check failed for domains: %v", failingSelfChecks)
+	}
+
+	return nil
+}
+
+// presentedAuthorization carries everything needed to accept an
+// Authorization's Challenge once its self-check has passed, and - for
+// dns-01 - to later clean it up as part of a batch.
+type presentedAuthorization struct {
+	auth      *acme.Authorization
+	challenge *acme.Challenge
+	domain    string
+	token     string
+	key       string
+	solver    Solver
+}
+
+// presentAuthorizations presents the challenges required to satisfy pending,
+// returning the subset whose self-check passed and the domains whose
+// self-check failed.
+//
+// dns-01 challenges are batched: PreSolve is called for every dns-01
+// authorization before any of them are checked, so that a provider which can
+// coalesce TXT record writes per zone only needs to be invoked once per
+// reconcile rather than once per domain, and so that all of the records can
+// propagate concurrently instead of one-by-one. Unlike PreSolve, cleaning up
+// those records is the caller's responsibility: it must not happen until
+// every accepted authorization in the batch has been confirmed valid by the
+// ACME server, so presentAuthorizations itself leaves the records in place.
+// Other challenge types are presented and checked one authorization at a
+// time, as before.
+func (a *Acme) presentAuthorizations(ctx context.Context, cl client.Interface, crt *v1alpha1.Certificate, pending []*acme.Authorization) ([]presentedAuthorization, []string, error) {
+	var dns01, other []*acme.Authorization
 	for _, auth := range pending {
-		selfCheckPassed, challenge, err := a.presentAuthorization(ctx, cl, crt, auth)
+		challenge, err := a.challengeForAuthorization(cl, crt, auth)
 		if err != nil {
-			return err
+			return nil, nil, err
+		}
+		if challenge.Type == "dns-01" {
+			dns01 = append(dns01, auth)
+		} else {
+			other = append(other, auth)
+		}
+	}
+
+	var passed []presentedAuthorization
+	var failed []string
+
+	batchPassed, batchFailed, err := a.presentDNS01Batch(ctx, cl, crt, dns01)
+	if err != nil {
+		return nil, nil, err
+	}
+	passed = append(passed, batchPassed...)
+	failed = append(failed, batchFailed...)
+
+	for _, auth := range other {
+		selfCheckPassed, p, err := a.presentAuthorization(ctx, cl, crt, auth)
+		if err != nil {
+			return nil, nil, err
 		}
 		if selfCheckPassed {
-			glog.Infof("Self check passed for domain %q", auth.Identifier.Value)
-			err := a.acceptChallenge(ctx, cl, auth, challenge)
-			if err != nil {
-				return err
-			}
+			passed = append(passed, p)
 		} else {
 			glog.Infof("Self check failed for domain %q", auth.Identifier.Value)
-			failingSelfChecks = append(failingSelfChecks, auth.Identifier.Value)
+			failed = append(failed, auth.Identifier.Value)
 		}
 	}
 
-	if len(failingSelfChecks) > 0 {
-		return fmt.Errorf("self check failed for domains: %v", failingSelfChecks)
+	return passed, failed, nil
+}
+
+// presentDNS01Batch presents every dns-01 authorization in auths using the
+// PreSolver phase described on presentAuthorizations, falling back to a
+// plain Present if the configured solver doesn't implement it, then checks
+// all of them. Each authorization it checks has its ChallengeState recorded
+// in a.store (including the DNS01 provider that was used), whether or not
+// its self-check passed, exactly as the non-batched path does, so
+// cleanupDNS01Batch - or, if
+// the process dies before that runs, a later cleanupAuthorization - can tear
+// it down without needing to re-derive it from crt.Spec.ACME.Config.
+// It does not clean up the records it presents; see cleanupDNS01Batch.
+func (a *Acme) presentDNS01Batch(ctx context.Context, cl client.Interface, crt *v1alpha1.Certificate, auths []*acme.Authorization) ([]presentedAuthorization, []string, error) {
+	if len(auths) == 0 {
+		return nil, nil, nil
+	}
+
+	var batch []presentedAuthorization
+	for _, auth := range auths {
+		challenge, err := a.challengeForAuthorization(cl, crt, auth)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := keyForChallenge(cl, challenge)
+		if err != nil {
+			return nil, nil, err
+		}
+		solver, err := a.solverFor(challenge.Type)
+		if err != nil {
+			return nil, nil, err
+		}
+		batch = append(batch, presentedAuthorization{
+			auth:      auth,
+			challenge: challenge,
+			domain:    auth.Identifier.Value,
+			token:     challenge.Token,
+			key:       key,
+			solver:    solver,
+		})
+	}
+
+	glog.Infof("Pre-solving %d dns-01 challenge(s) in a single batch", len(batch))
+	for _, p := range batch {
+		if preSolver, ok := p.solver.(PreSolver); ok {
+			if err := preSolver.PreSolve(ctx, crt, p.domain, p.token, p.key); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err := p.solver.Present(ctx, crt, p.domain, p.token, p.key); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var passed []presentedAuthorization
+	var failed []string
+	for _, p := range batch {
+		ok, err := p.solver.Check(p.domain, p.token, p.key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := putChallengeState(a.store, crt, v1alpha1.ChallengeState{
+			Domain:           p.domain,
+			AuthorizationURL: p.auth.URL,
+			Type:             p.challenge.Type,
+			Token:            p.token,
+			Key:              p.key,
+			Provider:         dns01ProviderForDomain(crt, p.domain),
+			PresentedAt:      metav1.Now(),
+		}); err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			glog.Infof("Self check failed for domain %q", p.domain)
+			failed = append(failed, p.domain)
+			continue
+		}
+		passed = append(passed, p)
+	}
+
+	return passed, failed, nil
+}
+
+// cleanupDNS01Batch tears down every dns-01 challenge in batch in one pass,
+// via PostCleanUp where the solver supports it (falling back to CleanUp),
+// and removes their ChallengeState from a.store now that they're no longer
+// in flight. Callers must only pass authorizations that have already been
+// accepted and confirmed valid - cleaning up before that point would remove
+// the TXT record before the ACME server validates it.
+func (a *Acme) cleanupDNS01Batch(ctx context.Context, crt *v1alpha1.Certificate, batch []presentedAuthorization) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	glog.Infof("Cleaning up %d dns-01 challenge(s) in a single batch", len(batch))
+	for _, p := range batch {
+		if postCleaner, ok := p.solver.(PostCleaner); ok {
+			if err := postCleaner.PostCleanUp(ctx, crt, p.domain, p.token, p.key); err != nil {
+				return err
+			}
+		} else if err := p.solver.CleanUp(ctx, crt, p.domain, p.token, p.key); err != nil {
+			return err
+		}
+		if err := deleteChallengeState(a.store, crt, p.domain); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// dns01ProviderForDomain returns the DNS01 provider name configured for
+// domain on crt, or "" if none is found.
+func dns01ProviderForDomain(crt *v1alpha1.Certificate, domain string) string {
+	for _, d := range crt.Spec.ACME.Config {
+		if d.DNS01 == nil {
+			continue
+		}
+		for _, dom := range d.Domains {
+			if dom == domain {
+				return d.DNS01.Provider
+			}
+		}
+	}
+	return ""
+}
+
 // getOrCreateOrder will attempt to retrieve an existing order for a
 // certificate using the status.acme.order.url field.
 //
@@ -171,6 +376,21 @@ func (a *Acme) getOrCreateOrder(ctx context.Context, cl client.Interface, crt *v
 		// TODO: log an event
 		glog.Infof("Existing order is in state %q - creating a new order.", order.Status)
 		return a.createOrder(ctx, cl, crt)
+	// RFC 8555 section 7.1.6: once every authorization has been satisfied the
+	// order moves to "ready", at which point we must POST the CSR to the
+	// order's finalize URL before it can transition to "processing"/"valid".
+	case acme.StatusReady:
+		glog.Infof("Order %q is ready - finalizing with CSR", order.URL)
+		// order.CSR is never populated by GetOrder (it isn't part of the
+		// ACME wire format - see acme.Order.CSR's doc-comment), so restore
+		// the CSR createOrder recorded on crt's status when it created this
+		// order, rather than finalizing with a nil CSR that every real ACME
+		// server will reject.
+		order.CSR = crt.Status.ACMEStatus().Order.CSR
+		if len(order.CSR) == 0 {
+			return nil, fmt.Errorf("order %q is ready to finalize but no CSR is recorded on certificate status", order.URL)
+		}
+		return cl.FinalizeOrder(ctx, order)
 	case acme.StatusValid, acme.StatusPending, acme.StatusProcessing:
 		return order, nil
 	}
@@ -206,52 +426,86 @@ func (a *Acme) acceptChallenge(ctx context.Context, cl client.Interface, auth *a
 // If ths authorization is already presented, it will return no error.
 // If the self-check for the authorization has passed, it will return true.
 // Otherwise it will return false.
-func (a *Acme) presentAuthorization(ctx context.Context, cl client.Interface, crt *v1alpha1.Certificate, auth *acme.Authorization) (bool, *acme.Challenge, error) {
+func (a *Acme) presentAuthorization(ctx context.Context, cl client.Interface, crt *v1alpha1.Certificate, auth *acme.Authorization) (bool, presentedAuthorization, error) {
 	glog.Infof("Presenting challenge for domain %q", auth.Identifier.Value)
 	challenge, err := a.challengeForAuthorization(cl, crt, auth)
 	if err != nil {
 		// TODO: handle error properly
-		return false, nil, err
+		return false, presentedAuthorization{}, err
 	}
 	domain := auth.Identifier.Value
 	token := challenge.Token
 	key, err := keyForChallenge(cl, challenge)
 	if err != nil {
-		return false, challenge, err
+		return false, presentedAuthorization{}, err
 	}
 	solver, err := a.solverFor(challenge.Type)
 	if err != nil {
 		// TODO: handle error properly
-		return false, challenge, err
+		return false, presentedAuthorization{}, err
 	}
+	p := presentedAuthorization{auth: auth, challenge: challenge, domain: domain, token: token, key: key, solver: solver}
+
 	err = solver.Present(ctx, crt, domain, token, key)
 	if err != nil {
 		// TODO: handle error properly
-		return false, challenge, err
+		return false, p, err
 	}
 	glog.Infof("Performing check to ensure challenge has propagated")
 	ok, err := solver.Check(domain, token, key)
 	if err != nil {
-		return false, challenge, err
+		return false, p, err
+	}
+
+	if err := putChallengeState(a.store, crt, v1alpha1.ChallengeState{
+		Domain:           domain,
+		AuthorizationURL: auth.URL,
+		Type:             challenge.Type,
+		Token:            token,
+		Key:              key,
+		Provider:         dns01ProviderForDomain(crt, domain),
+		PresentedAt:      metav1.Now(),
+	}); err != nil {
+		return false, p, err
 	}
-	return ok, challenge, nil
+
+	return ok, p, nil
 }
 
 // cleanupAuthorization will clean up a given authorization.
-// To do this, it first determines the challenge type to use for the
-// authorization based on the Issuer and Certificate configuration.
-// It then calls CleanUp on the appropriate Solver.
-// CleanUp will clean up any remaining resources left over from attempting to
-// solve the given challenge.
-// If a valid challenge type is not configured, cleanupAuthorization will
-// return an error.
+// If a ChallengeState was recorded for this authorization's domain in
+// a.store (because cert-manager itself presented it), that record is used
+// directly. This means cleanup no longer depends on the domain still being
+// present in crt.Spec.ACME.Config, so removing a domain from a Certificate
+// while its authorization is in progress still cleans up, e.g., the DNS
+// record it left behind.
+// Otherwise - for example for an authorization cert-manager didn't present
+// itself, such as one left over from before an upgrade - it falls back to
+// determining the challenge type from the Issuer and Certificate
+// configuration, as before.
+// It then calls CleanUp on the appropriate Solver, which will clean up any
+// remaining resources left over from attempting to solve the given
+// challenge. If a valid challenge type is not configured, cleanupAuthorization
+// will return an error.
 func (a *Acme) cleanupAuthorization(ctx context.Context, cl client.Interface, crt *v1alpha1.Certificate, auth *acme.Authorization) error {
 	glog.Infof("Cleaning up authorization for %q", auth.Identifier.Value)
+	domain := auth.Identifier.Value
+
+	if state, ok := getChallengeState(a.store, crt, domain); ok {
+		solver, err := a.solverFor(state.Type)
+		if err != nil {
+			return err
+		}
+		if err := solver.CleanUp(ctx, crt, domain, state.Token, state.Key); err != nil {
+			return err
+		}
+		return deleteChallengeState(a.store, crt, domain)
+	}
+
 	challenge, err := a.challengeForAuthorization(cl, crt, auth)
 	if err != nil {
 		return err
 	}
-	domain := auth.Identifier.Value
 	token := challenge.Token
 	key, err := keyForChallenge(cl, challenge)
 	if err != nil {
@@ -268,7 +522,7 @@ func (a *Acme) cleanupAuthorization(ctx context.Context, cl client.Interface, cr
 
 // keyForChallenge will return the key to use for solving a given acme
 // challenge.
-// Only http-01 and dns-01 challenges are supported.
+// http-01, dns-01 and tls-alpn-01 challenges are supported.
 // An error will be returned if obtaining the key fails, or the challenge type
 // is unsupported.
 func keyForChallenge(cl client.Interface, challenge *acme.Challenge) (string, error) {
@@ -278,6 +532,8 @@ func keyForChallenge(cl client.Interface, challenge *acme.Challenge) (string, er
 		return cl.HTTP01ChallengeResponse(challenge.Token)
 	case "dns-01":
 		return cl.DNS01ChallengeRecord(challenge.Token)
+	case "tls-alpn-01":
+		return cl.TLSALPN01ChallengeCert(challenge.Token)
 	default:
 		err = fmt.Errorf("unsupported challenge type %s", challenge.Type)
 	}
@@ -330,6 +586,8 @@ func (a *Acme) pickChallengeType(domain string, auth *acme.Authorization, cfg []
 						return challenge.Type, nil
 					case challenge.Type == "dns-01" && d.DNS01 != nil && a.issuer.GetSpec().ACME.DNS01 != nil:
 						return challenge.Type, nil
+					case challenge.Type == "tls-alpn-01" && d.TLSALPN01 != nil && a.issuer.GetSpec().ACME.TLSALPN01 != nil:
+						return challenge.Type, nil
 					}
 				}
 			}
@@ -0,0 +1,51 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+)
+
+// Solver solves ACME challenges by presenting the required token/key
+// material for a domain, confirming that the presentation can be observed
+// from the outside world, and cleaning up afterwards.
+type Solver interface {
+	Present(ctx context.Context, crt *v1alpha1.Certificate, domain, token, key string) error
+	Check(domain, token, key string) (bool, error)
+	CleanUp(ctx context.Context, crt *v1alpha1.Certificate, domain, token, key string) error
+}
+
+// PreSolver may optionally be implemented by a Solver that can present a
+// challenge as part of a batch covering multiple domains at once (for
+// example a dns-01 solver that can write several providers' TXT records in
+// one pass). PreSolve is only used for dns-01: when the dns-01 Solver
+// implements PreSolver, PreSolve is called instead of Present for every
+// pending dns-01 authorization before any of them are checked.
+type PreSolver interface {
+	PreSolve(ctx context.Context, crt *v1alpha1.Certificate, domain, token, key string) error
+}
+
+// PostCleaner may optionally be implemented by a Solver whose CleanUp is
+// cheaper to run once for a whole batch of domains than once per domain.
+// PostCleanUp is only used for dns-01: when the dns-01 Solver implements
+// PostCleaner, PostCleanUp is called instead of CleanUp for each
+// authorization in the batch once every one of them has been accepted and
+// confirmed valid by the ACME server.
+type PostCleaner interface {
+	PostCleanUp(ctx context.Context, crt *v1alpha1.Certificate, domain, token, key string) error
+}
+
+// solverFor returns the Solver responsible for completing challenges of the
+// given type.
+func (a *Acme) solverFor(challengeType string) (Solver, error) {
+	switch challengeType {
+	case "http-01":
+		return a.http01Solver, nil
+	case "dns-01":
+		return a.dns01Solver, nil
+	case "tls-alpn-01":
+		return a.tlsALPN01Solver, nil
+	}
+	return nil, fmt.Errorf("no solver configured for challenge type %q", challengeType)
+}
@@ -0,0 +1,90 @@
+package acme
+
+import (
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+)
+
+// Store persists the in-flight ACME challenge state for a Certificate so
+// that cleanupAuthorization can tear down a presented challenge without
+// needing to re-derive it from the Certificate's current spec (which may
+// have changed since the challenge was presented) or re-query the ACME
+// server.
+type Store interface {
+	// Get returns the ChallengeStates currently recorded for crt.
+	Get(crt *v1alpha1.Certificate) []v1alpha1.ChallengeState
+	// Put replaces the recorded ChallengeStates for crt with states.
+	Put(crt *v1alpha1.Certificate, states []v1alpha1.ChallengeState) error
+	// Delete removes the recorded ChallengeState for domain on crt, if any.
+	Delete(crt *v1alpha1.Certificate, domain string) error
+}
+
+// statusStore is the default Store implementation. It reads and writes
+// ChallengeState entries directly on the Certificate's
+// status.acme.challengeStates field, so no additional storage or RBAC is
+// required beyond what the controller already has to update Certificate
+// status: persistence to the API server happens the same way the rest of
+// Prepare's status changes do, via the controller's normal status update
+// once Prepare returns.
+type statusStore struct{}
+
+// NewStore returns the default Store, backed by the Certificate's own
+// status subresource.
+func NewStore() Store {
+	return &statusStore{}
+}
+
+func (s *statusStore) Get(crt *v1alpha1.Certificate) []v1alpha1.ChallengeState {
+	return crt.Status.ACMEStatus().ChallengeStates
+}
+
+func (s *statusStore) Put(crt *v1alpha1.Certificate, states []v1alpha1.ChallengeState) error {
+	crt.Status.ACMEStatus().ChallengeStates = states
+	return nil
+}
+
+func (s *statusStore) Delete(crt *v1alpha1.Certificate, domain string) error {
+	states := crt.Status.ACMEStatus().ChallengeStates
+	out := states[:0]
+	for _, st := range states {
+		if st.Domain != domain {
+			out = append(out, st)
+		}
+	}
+	crt.Status.ACMEStatus().ChallengeStates = out
+	return nil
+}
+
+// putChallengeState records (or replaces) the ChallengeState for
+// state.Domain via store.
+func putChallengeState(store Store, crt *v1alpha1.Certificate, state v1alpha1.ChallengeState) error {
+	states := store.Get(crt)
+	found := false
+	for i, s := range states {
+		if s.Domain == state.Domain {
+			states[i] = state
+			found = true
+			break
+		}
+	}
+	if !found {
+		states = append(states, state)
+	}
+	return store.Put(crt, states)
+}
+
+// getChallengeState returns the recorded ChallengeState for domain, if any,
+// via store.
+func getChallengeState(store Store, crt *v1alpha1.Certificate, domain string) (v1alpha1.ChallengeState, bool) {
+	for _, s := range store.Get(crt) {
+		if s.Domain == domain {
+			return s, true
+		}
+	}
+	return v1alpha1.ChallengeState{}, false
+}
+
+// deleteChallengeState removes the recorded ChallengeState for domain via
+// store.
+func deleteChallengeState(store Store, crt *v1alpha1.Certificate, domain string) error {
+	return store.Delete(crt, domain)
+}
@@ -0,0 +1,136 @@
+// Package tlsalpn01 implements the ACME tls-alpn-01 challenge type (RFC
+// 8737). It proves control of a domain by serving a short-lived, self-signed
+// certificate over a TLS handshake that negotiates the "acme-tls/1" ALPN
+// protocol, rather than by presenting a token over HTTP or DNS.
+package tlsalpn01
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+)
+
+// ALPNProto is the ALPN protocol name clients must negotiate in order to be
+// served the challenge certificate instead of the domain's real certificate.
+const ALPNProto = "acme-tls/1"
+
+// idPeACMEIdentifier is the OID for the acmeIdentifier certificate extension
+// (id-pe 1.3.6.1.5.5.7.1.31) defined by RFC 8737.
+var idPeACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// Solver implements the acme.Solver interface for the tls-alpn-01 challenge
+// type, presenting the challenge using a per-domain Kubernetes Service and
+// Secret, mirroring the existing http01 solver's pod/service pattern.
+type Solver struct {
+	// Client used to create/delete the Service and Secret that back the
+	// challenge listener. Left as an interface value so tests can swap in a
+	// fake.
+	KubeClient KubeClient
+}
+
+// KubeClient is the subset of Kubernetes client operations the solver needs
+// in order to stand up and tear down the challenge listener.
+type KubeClient interface {
+	EnsureService(crt *v1alpha1.Certificate, domain string, tlsSecretName string) error
+	EnsureSecret(crt *v1alpha1.Certificate, domain string, cert tls.Certificate) error
+	CleanupService(crt *v1alpha1.Certificate, domain string) error
+	CleanupSecret(crt *v1alpha1.Certificate, domain string) error
+}
+
+// NewSolver returns a new tls-alpn-01 Solver.
+func NewSolver(kubeClient KubeClient) *Solver {
+	return &Solver{KubeClient: kubeClient}
+}
+
+// Present generates a self-signed certificate authenticating the key
+// authorization for domain and provisions a Service/Secret so that ingress
+// traffic negotiating the acme-tls/1 ALPN protocol for domain is served that
+// certificate instead of the site's normal one.
+func (s *Solver) Present(ctx context.Context, crt *v1alpha1.Certificate, domain, token, key string) error {
+	glog.V(4).Infof("Generating tls-alpn-01 challenge certificate for domain %q", domain)
+	cert, err := ChallengeCert(domain, key)
+	if err != nil {
+		return fmt.Errorf("error generating tls-alpn-01 challenge certificate for domain %q: %s", domain, err.Error())
+	}
+
+	secretName := challengeSecretName(domain)
+	if err := s.KubeClient.EnsureSecret(crt, domain, cert); err != nil {
+		return err
+	}
+	return s.KubeClient.EnsureService(crt, domain, secretName)
+}
+
+// Check always returns true for tls-alpn-01: unlike http-01/dns-01 there is
+// no separate propagation step to wait on once the Service is serving the
+// challenge certificate, so the ACME server's own challenge fetch is the
+// only verification that matters.
+func (s *Solver) Check(domain, token, key string) (bool, error) {
+	return true, nil
+}
+
+// CleanUp removes the Service and Secret created by Present, restoring
+// normal TLS termination for domain.
+func (s *Solver) CleanUp(ctx context.Context, crt *v1alpha1.Certificate, domain, token, key string) error {
+	if err := s.KubeClient.CleanupService(crt, domain); err != nil {
+		return err
+	}
+	return s.KubeClient.CleanupSecret(crt, domain)
+}
+
+// ChallengeCert returns a self-signed certificate for domain whose
+// SubjectAltName contains domain and which carries the critical
+// acmeIdentifier extension containing the SHA-256 digest of the given key
+// authorization, as required by RFC 8737 section 3.
+func ChallengeCert(domain, keyAuthorization string) (tls.Certificate, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	digest := sha256.Sum256([]byte(keyAuthorization))
+	extValue, err := asn1.Marshal(digest[:])
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{domain},
+		ExtraExtensions: []pkix.Extension{
+			{
+				Id:       idPeACMEIdentifier,
+				Critical: true,
+				Value:    extValue,
+			},
+		},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  priv,
+	}, nil
+}
+
+func challengeSecretName(domain string) string {
+	return fmt.Sprintf("cm-tls-alpn-01-%x", sha256.Sum256([]byte(domain)))
+}
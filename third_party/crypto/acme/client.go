@@ -0,0 +1,401 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const jwsContentType = "application/jose+json"
+
+// Client is an RFC 8555 ACME client. Every request is authenticated with
+// Key, discovers endpoint URLs from DirectoryURL's directory object, and is
+// POSTed as a JWS using the flattened JSON serialization, per section 6.2.
+type Client struct {
+	DirectoryURL string
+	Key          *ecdsa.PrivateKey
+	HTTPClient   *http.Client
+
+	dirOnce sync.Once
+	dirErr  error
+	dir     Directory
+
+	nonceMu sync.Mutex
+	nonces  []string
+
+	accountURL string
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// discover fetches and caches the server's directory object.
+func (c *Client) discover(ctx context.Context) (Directory, error) {
+	c.dirOnce.Do(func() {
+		req, err := http.NewRequest(http.MethodGet, c.DirectoryURL, nil)
+		if err != nil {
+			c.dirErr = err
+			return
+		}
+		resp, err := c.httpClient().Do(req.WithContext(ctx))
+		if err != nil {
+			c.dirErr = err
+			return
+		}
+		defer resp.Body.Close()
+		c.dirErr = json.NewDecoder(resp.Body).Decode(&c.dir)
+		c.stashNonce(resp)
+	})
+	return c.dir, c.dirErr
+}
+
+func (c *Client) stashNonce(resp *http.Response) {
+	n := resp.Header.Get("Replay-Nonce")
+	if n == "" {
+		return
+	}
+	c.nonceMu.Lock()
+	c.nonces = append(c.nonces, n)
+	c.nonceMu.Unlock()
+}
+
+// nonce returns a nonce to sign the next request with, fetching a fresh one
+// from the server's newNonce endpoint if none is cached.
+func (c *Client) nonce(ctx context.Context) (string, error) {
+	c.nonceMu.Lock()
+	if n := len(c.nonces); n > 0 {
+		next := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		c.nonceMu.Unlock()
+		return next, nil
+	}
+	c.nonceMu.Unlock()
+
+	dir, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodHead, dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	n := resp.Header.Get("Replay-Nonce")
+	if n == "" {
+		return "", fmt.Errorf("acme: newNonce response carried no Replay-Nonce header")
+	}
+	return n, nil
+}
+
+// post signs body as a JWS addressed to url and POSTs it, retrying once if
+// the server rejects the nonce (RFC 8555 section 6.5). Once Register has set
+// c.accountURL, it is sent as the "kid" in place of embedding the account's
+// public key.
+func (c *Client) post(ctx context.Context, url string, body interface{}) (*http.Response, error) {
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		nonce, err := c.nonce(ctx)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := signJWS(c.Key, c.accountURL, nonce, url, body)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", jwsContentType)
+		resp, err := c.httpClient().Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		c.stashNonce(resp)
+
+		if resp.StatusCode >= 400 {
+			acmeErr := parseError(resp)
+			resp.Body.Close()
+			if acmeErr.ProblemType == "urn:ietf:params:acme:error:badNonce" && attempt == 0 {
+				lastErr = acmeErr
+				continue
+			}
+			return nil, acmeErr
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// postAsGet performs a POST-as-GET request (RFC 8555 section 6.3): an
+// empty-payload JWS used to fetch a resource that requires authentication,
+// rather than the bare unauthenticated GETs earlier ACME drafts allowed.
+func (c *Client) postAsGet(ctx context.Context, url string) (*http.Response, error) {
+	return c.post(ctx, url, nil)
+}
+
+func parseError(resp *http.Response) *Error {
+	e := &Error{StatusCode: resp.StatusCode}
+	body, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(body, e)
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil {
+			e.RetryAfter = time.Duration(secs) * time.Second
+		}
+	}
+	return e
+}
+
+// Register creates a new ACME account for c.Key (RFC 8555 section 7.3). If
+// eab is non-nil, it's presented as the account's external account binding
+// so CAs that require pre-authorized accounts will accept the registration.
+func (c *Client) Register(ctx context.Context, contacts []string, eab *ExternalAccountBinding) (*Account, error) {
+	dir, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := struct {
+		TermsOfServiceAgreed   bool            `json:"termsOfServiceAgreed"`
+		Contact                []string        `json:"contact,omitempty"`
+		ExternalAccountBinding json.RawMessage `json:"externalAccountBinding,omitempty"`
+	}{
+		TermsOfServiceAgreed: true,
+		Contact:              contacts,
+	}
+	if eab != nil {
+		eabJWS, err := signEAB(eab, c.Key.Public(), dir.NewAccount)
+		if err != nil {
+			return nil, err
+		}
+		req.ExternalAccountBinding = eabJWS
+	}
+
+	resp, err := c.post(ctx, dir.NewAccount, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var acc Account
+	if err := json.NewDecoder(resp.Body).Decode(&acc); err != nil {
+		return nil, err
+	}
+	acc.URI = resp.Header.Get("Location")
+	c.accountURL = acc.URI
+	return &acc, nil
+}
+
+// NewOrder creates a new order for domains (RFC 8555 section 7.4).
+func (c *Client) NewOrder(ctx context.Context, domains []string) (*Order, error) {
+	dir, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var idents []Identifier
+	for _, d := range domains {
+		idents = append(idents, Identifier{Type: "dns", Value: d})
+	}
+	reqBody := struct {
+		Identifiers []Identifier `json:"identifiers"`
+	}{Identifiers: idents}
+
+	resp, err := c.post(ctx, dir.NewOrder, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var o Order
+	if err := json.NewDecoder(resp.Body).Decode(&o); err != nil {
+		return nil, err
+	}
+	o.URL = resp.Header.Get("Location")
+	return &o, nil
+}
+
+// GetOrder fetches the current state of the order at url via POST-as-GET.
+func (c *Client) GetOrder(ctx context.Context, url string) (*Order, error) {
+	resp, err := c.postAsGet(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var o Order
+	if err := json.NewDecoder(resp.Body).Decode(&o); err != nil {
+		return nil, err
+	}
+	o.URL = url
+	return &o, nil
+}
+
+// GetAuthorization fetches the authorization at url via POST-as-GET.
+func (c *Client) GetAuthorization(ctx context.Context, url string) (*Authorization, error) {
+	resp, err := c.postAsGet(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var a Authorization
+	if err := json.NewDecoder(resp.Body).Decode(&a); err != nil {
+		return nil, err
+	}
+	a.URL = url
+	return &a, nil
+}
+
+// AcceptChallenge tells the server that challenge's key authorization is
+// ready to be validated, by POSTing an empty object to its URL.
+func (c *Client) AcceptChallenge(ctx context.Context, challenge *Challenge) (*Challenge, error) {
+	resp, err := c.post(ctx, challenge.URL, struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var ch Challenge
+	if err := json.NewDecoder(resp.Body).Decode(&ch); err != nil {
+		return nil, err
+	}
+	ch.URL = challenge.URL
+	return &ch, nil
+}
+
+// WaitAuthorization polls the authorization at url until it leaves the
+// pending/processing states or ctx is done.
+func (c *Client) WaitAuthorization(ctx context.Context, url string) (*Authorization, error) {
+	for {
+		authz, err := c.GetAuthorization(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		switch authz.Status {
+		case StatusPending, StatusProcessing:
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Second):
+			}
+			continue
+		default:
+			return authz, nil
+		}
+	}
+}
+
+// Finalize submits order.CSR to order's finalize URL, then polls until the
+// order leaves the processing state, returning the finalized order (whose
+// Certificate field, once Status is valid, is the URL to download the
+// issued chain from).
+func (c *Client) Finalize(ctx context.Context, order *Order) (*Order, error) {
+	reqBody := struct {
+		CSR string `json:"csr"`
+	}{CSR: base64RawURLEncode(order.CSR)}
+
+	resp, err := c.post(ctx, order.Finalize, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var o Order
+	if err := json.NewDecoder(resp.Body).Decode(&o); err != nil {
+		return nil, err
+	}
+	o.URL = order.URL
+
+	for o.Status == StatusProcessing {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+		o2, err := c.GetOrder(ctx, order.URL)
+		if err != nil {
+			return nil, err
+		}
+		o = *o2
+	}
+	return &o, nil
+}
+
+// FetchCertificate downloads the PEM certificate chain for a valid order.
+func (c *Client) FetchCertificate(ctx context.Context, order *Order) ([]byte, error) {
+	resp, err := c.postAsGet(ctx, order.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// RevokeCert revokes the DER-encoded certificate cert (RFC 8555 section 7.6).
+func (c *Client) RevokeCert(ctx context.Context, cert []byte, reason int) error {
+	dir, err := c.discover(ctx)
+	if err != nil {
+		return err
+	}
+	reqBody := struct {
+		Certificate string `json:"certificate"`
+		Reason      int    `json:"reason"`
+	}{
+		Certificate: base64RawURLEncode(cert),
+		Reason:      reason,
+	}
+	resp, err := c.post(ctx, dir.RevokeCert, reqBody)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// KeyChange rolls the account's key over to newKey (RFC 8555 section 7.3.5):
+// an outer JWS signed by the current key, wrapping an inner JWS signed by
+// the new key, both addressed to the keyChange URL.
+func (c *Client) KeyChange(ctx context.Context, newKey *ecdsa.PrivateKey) error {
+	dir, err := c.discover(ctx)
+	if err != nil {
+		return err
+	}
+
+	innerPayload := struct {
+		Account string      `json:"account"`
+		OldKey  interface{} `json:"oldKey"`
+	}{
+		Account: c.accountURL,
+		OldKey:  jwkFromKey(&c.Key.PublicKey),
+	}
+	innerJWS, err := signJWSNoNonce(newKey, dir.KeyChange, innerPayload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.post(ctx, dir.KeyChange, json.RawMessage(innerJWS))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	c.Key = newKey
+	return nil
+}
+
+func base64RawURLEncode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,207 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"math/big"
+)
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// jsonWebKey is the subset of RFC 7517 needed to embed an ECDSA P-256
+// account key in a JWS "jwk" header, as required for newAccount and
+// newOrder requests made before an account URL ("kid") is known.
+type jsonWebKey struct {
+	KTY string `json:"kty"`
+	CRV string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// DNS01RecordValue returns the value to publish in a _acme-challenge TXT
+// record for the given key authorization, per RFC 8555 section 8.4:
+// base64url(SHA256(keyAuthorization)).
+func DNS01RecordValue(keyAuthorization string) (string, error) {
+	sum := sha256.Sum256([]byte(keyAuthorization))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// JWKThumbprint returns the RFC 7638 JWK thumbprint of pub, base64url
+// encoded, as used to derive ACME key authorizations (RFC 8555 section
+// 8.1): keyAuthorization = token || "." || JWKThumbprint(accountKey).
+func JWKThumbprint(pub *ecdsa.PublicKey) (string, error) {
+	jwk := jwkFromKey(pub)
+	// RFC 7638 section 3.2: a JSON object with exactly the required
+	// members, lexicographically sorted, no whitespace.
+	canonical := fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk.CRV, jwk.KTY, jwk.X, jwk.Y)
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func jwkFromKey(pub *ecdsa.PublicKey) jsonWebKey {
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	return jsonWebKey{
+		KTY: "EC",
+		CRV: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+		Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+// jwsHeader is the JWS protected header used for every signed ACME request.
+// Per RFC 8555 section 6.2, every request must include "nonce" and "url",
+// and exactly one of "jwk" (before an account exists, or for key rollover's
+// inner JWS) or "kid" (the account URL, once registered).
+type jwsHeader struct {
+	Alg   string      `json:"alg"`
+	Nonce string      `json:"nonce,omitempty"`
+	URL   string      `json:"url"`
+	JWK   *jsonWebKey `json:"jwk,omitempty"`
+	Kid   string      `json:"kid,omitempty"`
+}
+
+// jwsObject is the flattened JSON serialization of a JWS (RFC 7515 section
+// 7.2.2), which is what RFC 8555 requires ACME requests to use.
+type jwsObject struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// signJWS signs payload (which may be nil for a POST-as-GET request) under
+// key, addressed to url, using nonce for anti-replay. If kid is non-empty
+// it's used in place of embedding the public key, per RFC 8555 section
+// 6.2 ("kid" once an account exists).
+func signJWS(key *ecdsa.PrivateKey, kid, nonce, url string, payload interface{}) ([]byte, error) {
+	header := jwsHeader{
+		Alg:   "ES256",
+		Nonce: nonce,
+		URL:   url,
+	}
+	if kid != "" {
+		header.Kid = kid
+	} else {
+		jwk := jwkFromKey(&key.PublicKey)
+		header.JWK = &jwk
+	}
+
+	protectedJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(protectedJSON)
+
+	var payloadEncoded string
+	if payload == nil {
+		payloadEncoded = ""
+	} else {
+		payloadJSON, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		payloadEncoded = base64.RawURLEncoding.EncodeToString(payloadJSON)
+	}
+
+	signingInput := protected + "." + payloadEncoded
+	digest := sha256.Sum256([]byte(signingInput))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig, err := encodeECDSASignature(key, r, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jwsObject{
+		Protected: protected,
+		Payload:   payloadEncoded,
+		Signature: base64.RawURLEncoding.EncodeToString(sig),
+	})
+}
+
+// encodeECDSASignature returns the raw (r||s) concatenation JWS requires for
+// ES256, rather than the ASN.1 DER encoding ecdsa.Sign's r/s would otherwise
+// imply.
+func encodeECDSASignature(key *ecdsa.PrivateKey, r, s *big.Int) ([]byte, error) {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	out := make([]byte, 2*size)
+	r.FillBytes(out[:size])
+	s.FillBytes(out[size:])
+	return out, nil
+}
+
+// signJWSNoNonce signs payload under key, addressed to url, embedding key's
+// own public key rather than a nonce or kid. This is the shape required for
+// the inner JWS of a key-rollover request (RFC 8555 section 7.3.5): it's
+// nested inside an outer, normally-noncedJWS, so it carries no nonce of its
+// own.
+func signJWSNoNonce(key *ecdsa.PrivateKey, url string, payload interface{}) ([]byte, error) {
+	return signJWS(key, "", "", url, payload)
+}
+
+// signEAB produces the inner JWS required by RFC 8555 section 7.3.4: an
+// HMAC-signed JWS over the account's public key, signed with the MAC key
+// the CA handed out of band, whose "kid" is the CA-assigned EAB key ID.
+func signEAB(eab *ExternalAccountBinding, accountKey crypto.PublicKey, url string) ([]byte, error) {
+	pub, ok := accountKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("acme: unsupported account key type %T for EAB", accountKey)
+	}
+	jwk := jwkFromKey(pub)
+
+	alg := eab.KeyAlgorithm
+	if alg == "" {
+		alg = "HS256"
+	}
+	var newHash func() hash.Hash
+	switch alg {
+	case "HS256":
+		newHash = sha256.New
+	case "HS384":
+		newHash = sha512.New384
+	case "HS512":
+		newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("acme: unsupported EAB key algorithm %q", alg)
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+		URL string `json:"url"`
+	}{Alg: alg, Kid: eab.KeyID, URL: url}
+
+	protectedJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(protectedJSON)
+
+	payloadJSON, err := json.Marshal(jwk)
+	if err != nil {
+		return nil, err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(payloadJSON)
+
+	mac := hmac.New(newHash, eab.Key)
+	mac.Write([]byte(protected + "." + payload))
+
+	return json.Marshal(jwsObject{
+		Protected: protected,
+		Payload:   payload,
+		Signature: base64.RawURLEncoding.EncodeToString(mac.Sum(nil)),
+	})
+}
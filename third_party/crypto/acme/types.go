@@ -0,0 +1,104 @@
+package acme
+
+import "time"
+
+// Status values used by Order, Authorization and Challenge resources, as
+// defined by RFC 8555 section 7.1.6.
+type Status string
+
+const (
+	StatusUnknown    Status = "unknown"
+	StatusPending    Status = "pending"
+	StatusProcessing Status = "processing"
+	StatusReady      Status = "ready"
+	StatusValid      Status = "valid"
+	StatusInvalid    Status = "invalid"
+	StatusDeactivated Status = "deactivated"
+	StatusRevoked    Status = "revoked"
+)
+
+// Directory mirrors the RFC 8555 section 7.1.1 directory object: the set of
+// endpoint URLs a client discovers before doing anything else.
+type Directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+	NewAuthz   string `json:"newAuthz,omitempty"`
+	RevokeCert string `json:"revokeCert"`
+	KeyChange  string `json:"keyChange"`
+}
+
+// Identifier is an ACME identifier, e.g. a DNS name.
+type Identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Account is an ACME account resource (RFC 8555 section 7.1.2).
+type Account struct {
+	URI     string   `json:"-"`
+	Status  Status   `json:"status"`
+	Contact []string `json:"contact,omitempty"`
+	Orders  string   `json:"orders,omitempty"`
+}
+
+// ExternalAccountBinding is presented during account registration so that
+// CAs requiring pre-authorized accounts can bind the new ACME account key to
+// an external identity (RFC 8555 section 7.3.4).
+type ExternalAccountBinding struct {
+	KeyID        string
+	Key          []byte // base64url-decoded HMAC key
+	KeyAlgorithm string // e.g. "HS256"; defaults to HS256 if empty
+}
+
+// Order is an ACME order resource (RFC 8555 section 7.1.3).
+type Order struct {
+	URL            string   `json:"-"`
+	Status         Status   `json:"status"`
+	Expires        string   `json:"expires,omitempty"`
+	Identifiers    []Identifier `json:"identifiers"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate,omitempty"`
+
+	// CSR is the DER-encoded CSR to submit to Finalize. It is populated by
+	// the caller that creates the order (typically once a Certificate's
+	// private key is available) and is not part of the ACME wire format.
+	CSR []byte `json:"-"`
+}
+
+// Authorization is an ACME authorization resource (RFC 8555 section 7.1.4).
+type Authorization struct {
+	URL        string      `json:"-"`
+	Status     Status      `json:"status"`
+	Identifier Identifier  `json:"identifier"`
+	Challenges []*Challenge `json:"challenges"`
+	Expires    string      `json:"expires,omitempty"`
+}
+
+// Challenge is an ACME challenge resource (RFC 8555 section 8).
+type Challenge struct {
+	URL   string `json:"url"`
+	Type  string `json:"type"`
+	Token string `json:"token"`
+	Status Status `json:"status"`
+}
+
+// Error represents an RFC 7807 "application/problem+json" error body
+// returned by an ACME server, including the urn:ietf:params:acme:error:*
+// problem types defined in RFC 8555 section 6.7.
+type Error struct {
+	StatusCode  int
+	ProblemType string `json:"type"`
+	Detail      string `json:"detail"`
+	// RetryAfter is parsed from the response's Retry-After header, if any
+	// accompanied this error (notably on rateLimited responses).
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e == nil {
+		return "<nil>"
+	}
+	return "acme: " + e.ProblemType + ": " + e.Detail
+}